@@ -0,0 +1,101 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// pkgPrefix prefixes the names of all functions in this package
+var pkgPrefix = reflect.TypeOf(logger{}).PkgPath() + "."
+
+// callerFrame returns the first stack frame outside of this package and the
+// log package, which is the call site of Info, Error or one of the helpers.
+func callerFrame() (runtime.Frame, bool) {
+	var pcs [32]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		// frames of the standard library logger are skipped for StdLogger
+		if !strings.HasPrefix(f.Function, pkgPrefix) && !strings.HasPrefix(f.Function, "log.") {
+			return f, f.PC != 0
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// callerEnabled returns true if the caller should be added to records logged
+// at the given level.
+func (l logger) callerEnabled(lvl zerolog.Level) bool {
+	if !l.opts.Caller {
+		return false
+	}
+	if len(l.opts.CallerLevels) == 0 {
+		return true
+	}
+	for _, cl := range l.opts.CallerLevels {
+		if cl == lvl {
+			return true
+		}
+	}
+	return false
+}
+
+// addCaller adds the call site to the event if enabled for the level, and the
+// calling function if CallerFunc is set, the source_url if SourceURLTemplate
+// is set, and the package of the function if Module is set.
+func (l logger) addCaller(e *zerolog.Event, lvl zerolog.Level) {
+	caller := l.callerEnabled(lvl)
+	if !caller && !l.opts.Module {
+		return
+	}
+	f, ok := callerFrame()
+	if !ok {
+		return
+	}
+	if caller {
+		e.Str(zerolog.CallerFieldName, zerolog.CallerMarshalFunc(f.File, f.Line))
+		if l.opts.CallerFunc {
+			e.Str("func", f.Function)
+		}
+		if l.opts.SourceURLTemplate != "" {
+			e.Str("source_url", strings.NewReplacer(
+				"{file}", f.File,
+				"{line}", strconv.Itoa(f.Line),
+			).Replace(l.opts.SourceURLTemplate))
+		}
+	}
+	if l.opts.Module {
+		e.Str("module", funcPackage(f.Function))
+	}
+}
+
+// funcPackage returns the package path of a fully qualified function name like
+// github.com/go-logr/logr.(*Logger).Info.
+func funcPackage(name string) string {
+	slash := strings.LastIndexByte(name, '/') + 1
+	if dot := strings.IndexByte(name[slash:], '.'); dot >= 0 {
+		return name[:slash+dot]
+	}
+	return name
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/butonic/zerologr"
+	"github.com/rs/zerolog"
+)
+
+func TestCallerLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := zerologr.NewWithOptions(zerologr.Options{
+		Writer:       buf,
+		Caller:       true,
+		CallerLevels: []zerolog.Level{zerolog.ErrorLevel},
+	})
+	l.Info("info")
+	l.Error(errors.New("oops"), "error")
+	dec := json.NewDecoder(buf)
+	for _, want := range []bool{false, true} {
+		var r map[string]interface{}
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		caller, ok := r[zerolog.CallerFieldName].(string)
+		if ok != want {
+			t.Errorf("%v: caller = %q, want caller %v", r["message"], caller, want)
+		}
+		if ok && !strings.Contains(caller, "caller_test.go:") {
+			t.Errorf("caller = %q, want caller_test.go", caller)
+		}
+	}
+}
+
+func TestModule(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := zerologr.NewWithOptions(zerologr.Options{Writer: buf, Module: true})
+	l.Info("test")
+	var r map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if got := r["module"]; got != "github.com/butonic/zerologr_test" {
+		t.Errorf("module = %v, want github.com/butonic/zerologr_test", got)
+	}
+}
+
+func TestCallerFunc(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := zerologr.NewWithOptions(zerologr.Options{Writer: buf, Caller: true, CallerFunc: true})
+	zerologr.Warn(l, "test")
+	var r map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if got := r["func"]; got != "github.com/butonic/zerologr_test.TestCallerFunc" {
+		t.Errorf("func = %v, want github.com/butonic/zerologr_test.TestCallerFunc", got)
+	}
+}
+
+func TestSourceURLTemplate(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := zerologr.NewWithOptions(zerologr.Options{
+		Writer:            buf,
+		Caller:            true,
+		SourceURLTemplate: "https://example.com/blob/main/{file}#L{line}",
+	})
+	_, file, line, _ := runtime.Caller(0)
+	l.Info("test")
+	var r map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("https://example.com/blob/main/%s#L%d", file, line+1)
+	if got := r["source_url"]; got != want {
+		t.Errorf("source_url = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+
+	"github.com/go-logr/logr"
+)
+
+// contextKey is the default key used to store a logger in a context.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries l.
+func NewContext(ctx context.Context, l logr.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx by NewContext.
+func FromContext(ctx context.Context) (logr.Logger, bool) {
+	return FromContextWithKey(ctx, contextKey{})
+}
+
+// NewContextWithKey returns a copy of ctx that carries l under the given key,
+// e.g. to avoid collisions with other libraries storing loggers in a context.
+// It panics if key is nil or not comparable.
+func NewContextWithKey(ctx context.Context, key interface{}, l logr.Logger) context.Context {
+	if !validKey(key) {
+		panic("zerologr: context key must be non-nil and comparable")
+	}
+	return context.WithValue(ctx, key, l)
+}
+
+// FromContextWithKey returns the logger stored in ctx by NewContextWithKey.
+func FromContextWithKey(ctx context.Context, key interface{}) (logr.Logger, bool) {
+	if !validKey(key) {
+		return nil, false
+	}
+	l, ok := ctx.Value(key).(logr.Logger)
+	return l, ok
+}
+
+func validKey(key interface{}) bool {
+	return key != nil && reflect.TypeOf(key).Comparable()
+}
+
+// InfoContext logs a non-error message like Info, adding the key-value pairs
+// returned by Options.SpanContextFields for ctx, e.g. a trace and span id.
+func InfoContext(ctx context.Context, l logr.InfoLogger, msg string, keysAndVals ...interface{}) {
+	if zl, ok := l.(logger); ok {
+		keysAndVals = zl.contextValues(ctx, keysAndVals)
+	}
+	l.Info(msg, keysAndVals...)
+}
+
+// ErrorContext logs an error like Error, adding the key-value pairs returned
+// by Options.SpanContextFields for ctx, e.g. a trace and span id.
+func ErrorContext(ctx context.Context, l logr.Logger, err error, msg string, keysAndVals ...interface{}) {
+	if zl, ok := l.(logger); ok {
+		keysAndVals = zl.contextValues(ctx, keysAndVals)
+	}
+	l.Error(err, msg, keysAndVals...)
+}
+
+// contextValues prepends the key-value pairs extracted from ctx.
+func (l logger) contextValues(ctx context.Context, keysAndVals []interface{}) []interface{} {
+	if l.opts.SpanContextFields == nil {
+		return keysAndVals
+	}
+	return append(l.opts.SpanContextFields(ctx), keysAndVals...)
+}
+
+// SpanContext identifies a span in a trace. It mirrors the fields of an
+// OpenTelemetry trace.SpanContext without depending on the OpenTelemetry
+// modules.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	TraceFlags byte
+}
+
+// IsValid reports whether both the trace and the span id are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// WithSpanContext returns a logger with the trace_id, span_id and trace_flags
+// of the span returned by Options.SpanFromContext for ctx bound as hex
+// strings. l is returned unchanged if there is no valid span or l is not a
+// zerologr logger.
+func WithSpanContext(ctx context.Context, l logr.Logger) logr.Logger {
+	zl, ok := l.(logger)
+	if !ok || zl.opts.SpanFromContext == nil {
+		return l
+	}
+	sc := zl.opts.SpanFromContext(ctx)
+	if !sc.IsValid() {
+		return l
+	}
+	return l.WithValues(
+		"trace_id", hex.EncodeToString(sc.TraceID[:]),
+		"span_id", hex.EncodeToString(sc.SpanID[:]),
+		"trace_flags", hex.EncodeToString([]byte{sc.TraceFlags}),
+	)
+}
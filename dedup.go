@@ -0,0 +1,94 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"sync"
+	"time"
+)
+
+// maxDedupEntries is the maximum number of tracked errors. When it is reached
+// expired entries are evicted, then the least recently logged one
+const maxDedupEntries = 1024
+
+// errorDedup suppresses identical errors logged within a time window.
+type errorDedup struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+type dedupEntry struct {
+	// logged is the time the error was last logged
+	logged     time.Time
+	suppressed int
+}
+
+func newErrorDedup(window time.Duration) *errorDedup {
+	return &errorDedup{
+		window:  window,
+		now:     time.Now,
+		entries: map[string]*dedupEntry{},
+	}
+}
+
+// allow reports whether the error should be logged by the logger with the
+// given name and how many identical errors have been suppressed since it was
+// last logged.
+func (d *errorDedup) allow(name, msg string, err error) (bool, int) {
+	key := name + "\x00" + msg
+	if err != nil {
+		key += "\x00" + err.Error()
+	}
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[key]
+	if ok && now.Sub(entry.logged) < d.window {
+		entry.suppressed++
+		return false, 0
+	}
+	if !ok {
+		if len(d.entries) >= maxDedupEntries {
+			d.evict(now)
+		}
+		entry = &dedupEntry{}
+		d.entries[key] = entry
+	}
+	suppressed := entry.suppressed
+	entry.logged = now
+	entry.suppressed = 0
+	return true, suppressed
+}
+
+// evict removes expired entries that have no pending suppressed count. If
+// none of them has expired the least recently logged entry is removed, losing
+// its suppressed count.
+func (d *errorDedup) evict(now time.Time) {
+	oldest := ""
+	for key, entry := range d.entries {
+		if entry.suppressed == 0 && now.Sub(entry.logged) >= d.window {
+			delete(d.entries, key)
+		} else if oldest == "" || entry.logged.Before(d.entries[oldest].logged) {
+			oldest = key
+		}
+	}
+	if len(d.entries) >= maxDedupEntries {
+		delete(d.entries, oldest)
+	}
+}
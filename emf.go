@@ -0,0 +1,66 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+// LogMetric logs a non-error message like Info with an AWS CloudWatch embedded
+// metric format (EMF) _aws block describing a metric with the given name and
+// unit, e.g. "Milliseconds", in namespace. The value is added under the metric
+// name. If l is not backed by zerologr the metric is added as a plain value.
+func LogMetric(l logr.InfoLogger, msg, namespace, name string, value float64, unit string, keysAndVals ...interface{}) {
+	if _, ok := l.(logger); !ok {
+		l.Info(msg, append(keysAndVals, name, value)...)
+		return
+	}
+	InfoWith(l, msg, func(e *zerolog.Event) {
+		directive := emfDirective{namespace: namespace, name: name, unit: unit}
+		e.Dict("_aws", zerolog.Dict().
+			Int64("Timestamp", time.Now().UnixNano()/int64(time.Millisecond)).
+			Array("CloudWatchMetrics", zerolog.Arr().Object(directive)))
+		e.Float64(name, value)
+	}, keysAndVals...)
+}
+
+// emfDirective is a metric directive of the embedded metric format
+type emfDirective struct {
+	namespace string
+	name      string
+	unit      string
+}
+
+func (d emfDirective) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("Namespace", d.namespace)
+	e.Array("Dimensions", zerolog.Arr().Interface([]string{}))
+	e.Array("Metrics", zerolog.Arr().Object(emfMetric{name: d.name, unit: d.unit}))
+}
+
+// emfMetric is a metric definition of the embedded metric format
+type emfMetric struct {
+	name string
+	unit string
+}
+
+func (m emfMetric) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("Name", m.name)
+	if m.unit != "" {
+		e.Str("Unit", m.unit)
+	}
+}
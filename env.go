@@ -0,0 +1,51 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+// LevelEnvVar is the name of the environment variable read by NewFromEnv
+var LevelEnvVar = "LOG_LEVEL"
+
+var invalidLevelOnce sync.Once
+
+// NewFromEnv returns a logr.Logger like New and sets the zerolog global level
+// from the environment variable named by LevelEnvVar, e.g. LOG_LEVEL=debug.
+// Unknown values set the global level to info and log a warning once. If the
+// variable is not set the global level is not changed.
+func NewFromEnv() logr.Logger {
+	l := New()
+	val, ok := os.LookupEnv(LevelEnvVar)
+	if !ok {
+		return l
+	}
+	lvl, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(val)))
+	if err != nil || lvl == zerolog.NoLevel {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		invalidLevelOnce.Do(func() {
+			Warn(l, "unknown log level, using info", "env", LevelEnvVar, "value", val)
+		})
+		return l
+	}
+	zerolog.SetGlobalLevel(lvl)
+	return l
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+var (
+	globalMu sync.RWMutex
+	global   logr.Logger
+)
+
+// flusher is implemented by buffered writers like bufio.Writer
+type flusher interface {
+	Flush() error
+}
+
+// SetLogger replaces the package-global logger.
+func SetLogger(l logr.Logger) {
+	globalMu.Lock()
+	global = l
+	globalMu.Unlock()
+}
+
+// GetLogger returns the package-global logger. If none was set it returns a
+// logger created by New.
+func GetLogger() logr.Logger {
+	globalMu.RLock()
+	l := global
+	globalMu.RUnlock()
+	if l != nil {
+		return l
+	}
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if global == nil {
+		global = New()
+	}
+	return global
+}
+
+// Shutdown replaces the package-global logger with one that discards all
+// records and then flushes and closes the Options.Closer of the previous
+// logger, e.g. an async diode writer. If Closer is nil the Options.Writer is
+// only flushed, it is not closed, so a logger writing to os.Stderr does not
+// close it. Writers are flushed if they implement Flush() error. Set Closer if
+// the logger was created with Options.Logger, whose writer is not known
+// otherwise. It returns early with the context error if ctx is done before the
+// writer has been flushed.
+func Shutdown(ctx context.Context) error {
+	nop := zerolog.Nop()
+	globalMu.Lock()
+	old := global
+	global = NewWithOptions(Options{Logger: &nop})
+	globalMu.Unlock()
+
+	zl, ok := old.(logger)
+	if !ok {
+		return nil
+	}
+	var w interface{} = zl.opts.Closer
+	closeIt := true
+	if zl.opts.Closer == nil {
+		if zl.opts.Writer == nil {
+			return nil
+		}
+		w, closeIt = zl.opts.Writer, false
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- closeWriter(w, closeIt)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeWriter flushes w if it supports it and closes it if closeIt is set.
+func closeWriter(w interface{}, closeIt bool) error {
+	if f, ok := w.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if c, ok := w.(io.Closer); ok && closeIt {
+		return c.Close()
+	}
+	return nil
+}
@@ -1,6 +1,6 @@
 module github.com/butonic/zerologr
 
-go 1.13
+go 1.17
 
 require (
 	github.com/go-logr/logr v0.1.0
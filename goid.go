@@ -0,0 +1,47 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+
+	"github.com/rs/zerolog"
+)
+
+var goroutinePrefix = []byte("goroutine ")
+
+// goroutineID parses the id of the current goroutine from the first line of
+// its stack trace, which looks like "goroutine 42 [running]:". It returns 0
+// if the id cannot be determined.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, goroutinePrefix)
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// goroutineIDHook adds the id of the logging goroutine to every event.
+var goroutineIDHook = zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
+	e.Uint64("goid", goroutineID())
+})
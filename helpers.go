@@ -0,0 +1,500 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+// WithFields returns a new logr.Logger with the given fields added as
+// key-value pairs, sorted by key to get a deterministic order.
+func WithFields(l logr.Logger, fields map[string]interface{}) logr.Logger {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvList := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		kvList = append(kvList, k, fields[k])
+	}
+	return l.WithValues(kvList...)
+}
+
+// InfoWith logs a non-error message like Info and calls fn with the zerolog
+// event after all other fields have been added, e.g. to add typed fields. fn
+// is not called if l is not backed by zerologr or the record is not logged.
+func InfoWith(l logr.InfoLogger, msg string, fn func(e *zerolog.Event), keysAndVals ...interface{}) {
+	if zl, ok := l.(logger); ok {
+		if zl.recorded() {
+			zl.log(zl.level(), msg, keysAndVals, fn)
+		}
+		return
+	}
+	l.Info(msg, keysAndVals...)
+}
+
+// WithStruct returns a new logr.Logger with the exported fields of the struct v
+// added as prefix.FieldName key-value pairs. Zero fields are skipped if
+// Options.OmitZeroStructFields is set. If v is not a struct or a pointer to a
+// struct it is added under prefix.
+func WithStruct(l logr.Logger, prefix string, v interface{}) logr.Logger {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return l.WithValues(prefix, v)
+	}
+	omitZero := false
+	if zl, ok := l.(logger); ok {
+		omitZero = zl.opts.OmitZeroStructFields
+	}
+	if prefix != "" {
+		prefix += "."
+	}
+	rt := rv.Type()
+	kvList := make([]interface{}, 0, 2*rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		fv := rv.Field(i)
+		if omitZero && fv.IsZero() {
+			continue
+		}
+		kvList = append(kvList, prefix+f.Name, fv.Interface())
+	}
+	return l.WithValues(kvList...)
+}
+
+// Warn logs a non-error message at zerolog.WarnLevel, regardless of the
+// verbosity of l. If l is not backed by zerologr the message is logged using
+// Info.
+func Warn(l logr.InfoLogger, msg string, keysAndVals ...interface{}) {
+	if zl, ok := l.(logger); ok {
+		zl.log(zerolog.WarnLevel, msg, keysAndVals, nil)
+		return
+	}
+	l.Info(msg, keysAndVals...)
+}
+
+// Timer returns a function that logs msg like Info when called, adding the
+// time elapsed since Timer was called as duration.
+func Timer(l logr.InfoLogger, msg string) func(keysAndVals ...interface{}) {
+	start := time.Now()
+	return func(keysAndVals ...interface{}) {
+		d := time.Since(start)
+		zl, ok := l.(logger)
+		if !ok {
+			l.Info(msg, append(keysAndVals, "duration", d)...)
+			return
+		}
+		InfoWith(l, msg, func(e *zerolog.Event) {
+			// addValue adds the bucket for WithLatencyBuckets
+			zl.addValue(e, "duration", d)
+		}, keysAndVals...)
+	}
+}
+
+// InfoInterval logs a non-error message like Info, adding an interval object
+// with the start, end and the duration between them.
+func InfoInterval(l logr.InfoLogger, msg string, start, end time.Time, keysAndVals ...interface{}) {
+	d := end.Sub(start)
+	if _, ok := l.(logger); !ok {
+		l.Info(msg, append(keysAndVals, "interval", map[string]interface{}{
+			"start":    start,
+			"end":      end,
+			"duration": d,
+		})...)
+		return
+	}
+	InfoWith(l, msg, func(e *zerolog.Event) {
+		e.Dict("interval", zerolog.Dict().
+			Time("start", start).
+			Time("end", end).
+			Dur("duration", d))
+	}, keysAndVals...)
+}
+
+// LogDiff logs a non-error message like Info, adding the keys of new missing
+// from old as added, the keys of old missing from new as removed and the keys
+// with different values as changed objects. Changed keys have an object with
+// the old and new value.
+func LogDiff(l logr.InfoLogger, msg string, old, new map[string]interface{}) {
+	added := map[string]interface{}{}
+	removed := map[string]interface{}{}
+	changed := map[string]interface{}{}
+	for k, nv := range new {
+		ov, ok := old[k]
+		if !ok {
+			added[k] = nv
+		} else if !reflect.DeepEqual(ov, nv) {
+			changed[k] = map[string]interface{}{"old": ov, "new": nv}
+		}
+	}
+	for k, ov := range old {
+		if _, ok := new[k]; !ok {
+			removed[k] = ov
+		}
+	}
+	zl, ok := l.(logger)
+	if !ok {
+		l.Info(msg, "added", added, "removed", removed, "changed", changed)
+		return
+	}
+	InfoWith(l, msg, func(e *zerolog.Event) {
+		e.Dict("added", zl.dict(added))
+		e.Dict("removed", zl.dict(removed))
+		e.Dict("changed", zl.dict(changed))
+	})
+}
+
+// dict returns the entries of m sorted by key as a zerolog dict.
+func (l logger) dict(m map[string]interface{}) *zerolog.Event {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	d := zerolog.Dict()
+	for _, k := range keys {
+		if sub, ok := m[k].(map[string]interface{}); ok {
+			d.Dict(k, l.dict(sub))
+		} else {
+			l.addValue(d, k, m[k])
+		}
+	}
+	return d
+}
+
+// InfoCron logs a non-error message like Info, adding the cron expression expr
+// as cron and the time returned by next for expr and the current time as
+// next_run. next is typically the parser of a cron library. If next fails its
+// error is added as cron_error instead of next_run.
+func InfoCron(l logr.InfoLogger, msg, expr string, next func(expr string, from time.Time) (time.Time, error), keysAndVals ...interface{}) {
+	t, err := next(expr, time.Now())
+	if _, ok := l.(logger); !ok {
+		if err != nil {
+			l.Info(msg, append(keysAndVals, "cron", expr, "cron_error", err.Error())...)
+		} else {
+			l.Info(msg, append(keysAndVals, "cron", expr, "next_run", t)...)
+		}
+		return
+	}
+	InfoWith(l, msg, func(e *zerolog.Event) {
+		e.Str("cron", expr)
+		if err != nil {
+			e.Str("cron_error", err.Error())
+		} else {
+			e.Time("next_run", t)
+		}
+	}, keysAndVals...)
+}
+
+// Merge returns a copy of base with the values bound to overlay appended.
+// Values of base with a key that is also bound to overlay are dropped. The
+// zerolog logger, name and verbosity of base are kept. It returns false if
+// either logger is not backed by zerologr.
+func Merge(base, overlay logr.Logger) (logr.Logger, bool) {
+	b, ok := base.(logger)
+	if !ok {
+		return base, false
+	}
+	o, ok := overlay.(logger)
+	if !ok {
+		return base, false
+	}
+	keys := map[string]bool{}
+	for i := 0; i < len(o.values); i += 2 {
+		if k, isString := o.values[i].(string); isString {
+			keys[k] = true
+		}
+	}
+	out := b.clone()
+	out.values = make([]interface{}, 0, len(b.values)+len(o.values))
+	for i := 0; i < len(b.values); i += 2 {
+		if k, isString := b.values[i].(string); isString && keys[k] {
+			continue
+		}
+		if i+1 < len(b.values) {
+			out.values = append(out.values, b.values[i], b.values[i+1])
+		} else {
+			out.values = append(out.values, b.values[i])
+		}
+	}
+	out.values = append(out.values, o.values...)
+	return out, true
+}
+
+// AtLevel returns a new logr.Logger that logs non-error messages at the given
+// zerolog level, regardless of its verbosity. If l is not backed by zerologr
+// it is returned unchanged.
+func AtLevel(l logr.Logger, lvl zerolog.Level) logr.Logger {
+	zl, ok := l.(logger)
+	if !ok {
+		return l
+	}
+	out := zl.clone()
+	out.fixed = true
+	out.fixedLevel = lvl
+	return out
+}
+
+// WithMessagePrefix returns a new logr.Logger that prepends prefix to the
+// message of every record. Prefixes of repeated calls are prepended in the
+// order of the calls. If l is not backed by zerologr it is returned unchanged.
+func WithMessagePrefix(l logr.Logger, prefix string) logr.Logger {
+	zl, ok := l.(logger)
+	if !ok {
+		return l
+	}
+	out := zl.clone()
+	out.msgPrefix += prefix
+	return out
+}
+
+// WithLabel returns a new logr.Logger with the label k set to v. All labels are
+// added as a labels object, sorted by key, to every record. If l is not backed
+// by zerologr the label is added as a labels.k key-value pair instead.
+func WithLabel(l logr.Logger, k, v string) logr.Logger {
+	zl, ok := l.(logger)
+	if !ok {
+		return l.WithValues("labels."+k, v)
+	}
+	out := zl.clone()
+	out.labels = make(map[string]string, len(zl.labels)+1)
+	for lk, lv := range zl.labels {
+		out.labels[lk] = lv
+	}
+	out.labels[k] = v
+	return out
+}
+
+// Fatal logs an error like Error and then exits the program by calling
+// Options.Exit with Options.ExitCode, unless Options.DryRun is set. The Writer
+// is flushed before exiting if it is buffered. If l is not backed by zerologr
+// os.Exit(1) is called.
+func Fatal(l logr.Logger, err error, msg string, keysAndVals ...interface{}) {
+	l.Error(err, msg, keysAndVals...)
+	zl, ok := l.(logger)
+	if !ok {
+		os.Exit(1)
+	}
+	if zl.opts.DryRun {
+		return
+	}
+	zl.flush()
+	code := zl.opts.ExitCode
+	if code == 0 {
+		code = 1
+	}
+	exit := zl.opts.Exit
+	if exit == nil {
+		exit = os.Exit
+	}
+	exit(code)
+}
+
+// Zerolog returns the zerolog logger used by l, e.g. to log with the zerolog
+// API. It returns false if l is not backed by zerologr.
+func Zerolog(l logr.InfoLogger) (*zerolog.Logger, bool) {
+	zl, ok := l.(logger)
+	if !ok {
+		return nil, false
+	}
+	return zl.l, true
+}
+
+// WithMemStats returns a new logr.Logger that adds the bytes of allocated heap
+// objects as heap_alloc_bytes to every record. The memory statistics are read
+// with runtime.ReadMemStats only when a record is written, which stops the
+// world, so this is meant for debugging leaks and not for hot paths. If l is
+// not backed by zerologr it is returned unchanged.
+func WithMemStats(l logr.Logger) logr.Logger {
+	zl, ok := l.(logger)
+	if !ok {
+		return l
+	}
+	out := zl.clone()
+	out.memStats = true
+	return out
+}
+
+// lazyValue is a value computed when it is added to a record, see Lazy.
+type lazyValue func() interface{}
+
+// Lazy returns a value for key-value pairs that is computed by calling fn when
+// a record is written, so fn is not called for records that are not logged.
+// Records only kept in memory for Options.RingBufferSize omit the value. fn is
+// called for every record written with the value, e.g. when it is bound with
+// WithValues. Loggers not backed by zerologr log the func itself.
+func Lazy(fn func() interface{}) interface{} {
+	return lazyValue(fn)
+}
+
+// StdLogger returns a log.Logger that logs every line written to it like Info,
+// e.g. for packages that only support the standard library logger. The
+// logger has no prefix and flags, the trailing newline is removed.
+func StdLogger(l logr.InfoLogger) *log.Logger {
+	return log.New(stdWriter{l: l}, "", 0)
+}
+
+// stdWriter logs every write as a message.
+type stdWriter struct {
+	l logr.InfoLogger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.l.Info(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// WithLatencyBuckets returns a new logr.Logger that adds the smallest of the
+// bucket boundaries that is not lower than a logged duration value as bucket,
+// e.g. 100ms, or +Inf if it is higher than all boundaries. If l is not backed
+// by zerologr it is returned unchanged.
+func WithLatencyBuckets(l logr.Logger, buckets []time.Duration) logr.Logger {
+	zl, ok := l.(logger)
+	if !ok {
+		return l
+	}
+	out := zl.clone()
+	out.buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(out.buckets, func(i, j int) bool { return out.buckets[i] < out.buckets[j] })
+	return out
+}
+
+// InfoAt logs a non-error message like Info with t as its timestamp instead
+// of the current time, e.g. to replay historical events. If Options.Logger
+// adds a timestamp itself the record will contain both.
+func InfoAt(l logr.InfoLogger, t time.Time, msg string, keysAndVals ...interface{}) {
+	zl, ok := l.(logger)
+	if !ok {
+		l.Info(msg, keysAndVals...)
+		return
+	}
+	if zl.recorded() {
+		zl.timestamp = false
+		zl.log(zl.level(), msg, keysAndVals, func(e *zerolog.Event) {
+			zl.addTime(e, t)
+		})
+	}
+}
+
+// severityLevels maps syslog severities to zerolog levels, like the inverse of
+// the zerolog syslog writer.
+var severityLevels = [...]zerolog.Level{
+	0: zerolog.PanicLevel, // emerg
+	1: zerolog.FatalLevel, // alert
+	2: zerolog.FatalLevel, // crit
+	3: zerolog.ErrorLevel, // err
+	4: zerolog.WarnLevel,  // warning
+	5: zerolog.InfoLevel,  // notice
+	6: zerolog.InfoLevel,  // info
+	7: zerolog.DebugLevel, // debug
+}
+
+// LogSeverity logs a message at the zerolog level matching the syslog severity
+// sev, from 0 (emerg) to 7 (debug). Lower values are treated as emerg and
+// higher ones as debug. Records at the panic and fatal levels do not stop the
+// program. If l is not backed by zerologr the message is logged using Info.
+func LogSeverity(l logr.InfoLogger, sev int, msg string, keysAndVals ...interface{}) {
+	zl, ok := l.(logger)
+	if !ok {
+		l.Info(msg, keysAndVals...)
+		return
+	}
+	if sev < 0 {
+		sev = 0
+	} else if sev >= len(severityLevels) {
+		sev = len(severityLevels) - 1
+	}
+	zl.log(severityLevels[sev], msg, keysAndVals, nil)
+}
+
+// DumpRing returns the most recent records kept because of
+// Options.RingBufferSize, oldest first. It returns nil if l is not backed by
+// zerologr or has no ring buffer.
+func DumpRing(l logr.Logger) [][]byte {
+	zl, ok := l.(logger)
+	if !ok || zl.ring == nil {
+		return nil
+	}
+	return zl.ring.dump()
+}
+
+// Clone returns an independent copy of l that does not share its bound values.
+// It returns false if l is not backed by zerologr.
+func Clone(l logr.Logger) (logr.Logger, bool) {
+	zl, ok := l.(logger)
+	if !ok {
+		return l, false
+	}
+	return zl.clone(), true
+}
+
+// WithRequest returns a new logr.Logger with the method, path, host and remote
+// address of r added as http.method, http.path, http.host and
+// http.remote_addr.
+func WithRequest(l logr.Logger, r *http.Request) logr.Logger {
+	if r == nil {
+		return l
+	}
+	path := ""
+	if r.URL != nil {
+		path = r.URL.Path
+	}
+	return l.WithValues(
+		"http.method", r.Method,
+		"http.path", path,
+		"http.host", r.Host,
+		"http.remote_addr", r.RemoteAddr,
+	)
+}
+
+// ErrorPanic logs a value returned by recover like Error. The value is added
+// as panic, together with the stack of the calling goroutine as stack. If the
+// value is an error it is logged as the error as well and its message is
+// added as panic.
+func ErrorPanic(l logr.Logger, recovered interface{}, msg string, keysAndVals ...interface{}) {
+	err, _ := recovered.(error)
+	if err != nil {
+		// errors like runtime.Error have no exported fields to marshal
+		recovered = err.Error()
+	}
+	stack := string(debug.Stack())
+	zl, ok := l.(logger)
+	if !ok {
+		l.Error(err, msg, append(keysAndVals, "panic", recovered, "stack", stack)...)
+		return
+	}
+	zl.error(err, msg, keysAndVals, func(e *zerolog.Event) {
+		zl.addValue(e, "panic", recovered)
+		e.Str(zerolog.ErrorStackFieldName, stack)
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	localMu     sync.RWMutex
+	localFields = map[uint64][]interface{}{}
+	// localCount is the number of entries of localFields, it is read without
+	// the lock so records are not slowed down if no fields are set
+	localCount int32
+)
+
+// SetLocalFields sets key-value pairs that are added to every record logged
+// by the calling goroutine, after the bound values, until ClearLocalFields is
+// called. This is a best-effort registry keyed by the goroutine id, which is
+// parsed from a stack trace for every record while any fields are set. The
+// fields are not inherited by goroutines started later, and they are kept
+// after the goroutine exited until ClearLocalFields is called, so forgetting
+// to call it leaks them. Prefer binding values with WithValues where possible.
+func SetLocalFields(keysAndVals ...interface{}) {
+	id := goroutineID()
+	if id == 0 {
+		return
+	}
+	localMu.Lock()
+	localFields[id] = copySlice(keysAndVals)
+	atomic.StoreInt32(&localCount, int32(len(localFields)))
+	localMu.Unlock()
+}
+
+// ClearLocalFields removes the key-value pairs set by SetLocalFields for the
+// calling goroutine.
+func ClearLocalFields() {
+	id := goroutineID()
+	localMu.Lock()
+	delete(localFields, id)
+	atomic.StoreInt32(&localCount, int32(len(localFields)))
+	localMu.Unlock()
+}
+
+// localValues returns the key-value pairs set for the calling goroutine. The
+// lock is only taken and the goroutine id only determined if any fields are
+// set.
+func localValues() []interface{} {
+	if atomic.LoadInt32(&localCount) == 0 {
+		return nil
+	}
+	id := goroutineID()
+	localMu.RLock()
+	defer localMu.RUnlock()
+	return localFields[id]
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package zerologr
+
+import (
+	"log/slog"
+
+	"github.com/rs/zerolog"
+)
+
+// expandAttrs replaces the slog.Attr values in keysAndVals with key-value pairs.
+// Groups are added as objects, or inlined if their key is empty.
+func (l logger) expandAttrs(keysAndVals []interface{}) []interface{} {
+	found := false
+	for _, kv := range keysAndVals {
+		if _, ok := kv.(slog.Attr); ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return keysAndVals
+	}
+	out := make([]interface{}, 0, len(keysAndVals)+1)
+	for i := 0; i < len(keysAndVals); i++ {
+		a, ok := keysAndVals[i].(slog.Attr)
+		if !ok {
+			// keep the pair together, so a slog.Attr value is not expanded
+			out = append(out, keysAndVals[i])
+			if i+1 < len(keysAndVals) {
+				out = append(out, keysAndVals[i+1])
+				i++
+			}
+			continue
+		}
+		out = l.appendAttr(out, a)
+	}
+	return out
+}
+
+// appendAttr appends a as a key-value pair to kv.
+func (l logger) appendAttr(kv []interface{}, a slog.Attr) []interface{} {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		if a.Key == "" {
+			// slog ignores empty attrs
+			return kv
+		}
+		return append(kv, a.Key, v.Any())
+	}
+	if a.Key == "" {
+		for _, ga := range v.Group() {
+			kv = l.appendAttr(kv, ga)
+		}
+		return kv
+	}
+	return append(kv, a.Key, attrGroup{l: l, attrs: v.Group()})
+}
+
+// attrGroup is a slog group logged as an object.
+type attrGroup struct {
+	l     logger
+	attrs []slog.Attr
+}
+
+func (g attrGroup) MarshalZerologObject(e *zerolog.Event) {
+	var kv []interface{}
+	for _, a := range g.attrs {
+		kv = g.l.appendAttr(kv, a)
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		g.l.addValue(e, kv[i].(string), kv[i+1])
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package zerologr
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestSlogAttrs(t *testing.T) {
+	l, buf := newTestLogger(Options{})
+	l.WithValues(slog.String("bound", "x")).Info("test",
+		"a", 1,
+		slog.String("b", "x"),
+		slog.Group("g", slog.Int("c", 2), slog.Group("h", slog.Bool("d", true))),
+		slog.Group("", slog.Int("e", 3)),
+		slog.Attr{},
+		"f", slog.Int("g", 4),
+	)
+	r := record(t, buf)
+	want := map[string]interface{}{
+		"bound": "x",
+		"a":     float64(1),
+		"b":     "x",
+		"g":     map[string]interface{}{"c": float64(2), "h": map[string]interface{}{"d": true}},
+		"e":     float64(3),
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(r[k], v) {
+			t.Errorf("%s = %v, want %v", k, r[k], v)
+		}
+	}
+	if _, ok := r["f"]; !ok {
+		t.Error("the slog.Attr value of f was expanded")
+	}
+	if e, ok := r["zerologr-err"]; ok {
+		t.Errorf("zerologr-err = %v", e)
+	}
+}
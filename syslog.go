@@ -0,0 +1,91 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9
+
+package zerologr
+
+import (
+	"log/syslog"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+// NewSyslog returns a logr.Logger like NewWithOptions that writes to the local
+// syslog daemon using the given tag. Records are sent with the syslog priority
+// matching their zerolog level. Options.Logger and Options.Writer are ignored.
+func NewSyslog(tag string, opts Options) (logr.Logger, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	opts.Logger = nil
+	opts.Writer = syslogWriter{w: w}
+	return NewWithOptions(opts), nil
+}
+
+// syslogPriority returns the syslog severity for a zerolog level.
+func syslogPriority(level zerolog.Level) syslog.Priority {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return syslog.LOG_DEBUG
+	case zerolog.WarnLevel:
+		return syslog.LOG_WARNING
+	case zerolog.ErrorLevel:
+		return syslog.LOG_ERR
+	case zerolog.FatalLevel:
+		return syslog.LOG_CRIT
+	case zerolog.PanicLevel:
+		return syslog.LOG_EMERG
+	default:
+		return syslog.LOG_INFO
+	}
+}
+
+// syslogWriter writes records with the priority matching their level.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func (s syslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var err error
+	m := string(p)
+	switch syslogPriority(level) {
+	case syslog.LOG_DEBUG:
+		err = s.w.Debug(m)
+	case syslog.LOG_WARNING:
+		err = s.w.Warning(m)
+	case syslog.LOG_ERR:
+		err = s.w.Err(m)
+	case syslog.LOG_CRIT:
+		err = s.w.Crit(m)
+	case syslog.LOG_EMERG:
+		err = s.w.Emerg(m)
+	default:
+		err = s.w.Info(m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s syslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9
+
+package zerologr
+
+import (
+	"log/syslog"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSyslogPriority(t *testing.T) {
+	tests := []struct {
+		level zerolog.Level
+		want  syslog.Priority
+	}{
+		{zerolog.TraceLevel, syslog.LOG_DEBUG},
+		{zerolog.DebugLevel, syslog.LOG_DEBUG},
+		{zerolog.InfoLevel, syslog.LOG_INFO},
+		{zerolog.WarnLevel, syslog.LOG_WARNING},
+		{zerolog.ErrorLevel, syslog.LOG_ERR},
+		{zerolog.FatalLevel, syslog.LOG_CRIT},
+		{zerolog.PanicLevel, syslog.LOG_EMERG},
+		{zerolog.NoLevel, syslog.LOG_INFO},
+	}
+	for _, tt := range tests {
+		if got := syslogPriority(tt.level); got != tt.want {
+			t.Errorf("syslogPriority(%v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2019 Jorn Friedrich Dreyer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zerologr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// writeLevel writes p to w, passing the level on if w is a zerolog.LevelWriter.
+func writeLevel(w io.Writer, level zerolog.Level, p []byte) (int, error) {
+	if lw, ok := w.(zerolog.LevelWriter); ok {
+		return lw.WriteLevel(level, p)
+	}
+	return w.Write(p)
+}
+
+// levelWriter passes level on to w for every write, e.g. for the output of a
+// zerolog.ConsoleWriter.
+type levelWriter struct {
+	w     io.Writer
+	level zerolog.Level
+}
+
+func (l levelWriter) Write(p []byte) (int, error) {
+	return writeLevel(l.w, l.level, p)
+}
+
+// consoleLeadingFields are written by consoleWriter right before the message,
+// the zerolog.ConsoleWriter would sort them with all other fields.
+var consoleLeadingFields = []string{"name", "verbosity"}
+
+// consoleWriter writes records using a zerolog.ConsoleWriter and passes the
+// level of the records on to its output. The consoleLeadingFields are moved in
+// front of the message.
+type consoleWriter struct {
+	cw zerolog.ConsoleWriter
+}
+
+func (c consoleWriter) Write(p []byte) (int, error) {
+	return c.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (c consoleWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	cw := c.cw
+	cw.Out = levelWriter{w: cw.Out, level: level}
+	b, lead := consoleLead(p, cw.NoColor)
+	if lead != "" {
+		format := cw.FormatMessage
+		cw.FormatMessage = func(i interface{}) string {
+			if format != nil {
+				return lead + " " + format(i)
+			}
+			if i == nil {
+				return lead
+			}
+			return fmt.Sprintf("%s %s", lead, i)
+		}
+	}
+	if _, err := cw.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// consoleLead removes the consoleLeadingFields from the JSON record p and
+// returns them formatted like the fields of a zerolog.ConsoleWriter. p is
+// returned unchanged if it has none of the fields or cannot be decoded.
+func consoleLead(p []byte, noColor bool) ([]byte, string) {
+	var evt map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err := d.Decode(&evt); err != nil {
+		return p, ""
+	}
+	var lead []string
+	for _, k := range consoleLeadingFields {
+		v, ok := evt[k]
+		if !ok {
+			continue
+		}
+		delete(evt, k)
+		name := k + "="
+		if !noColor {
+			// the cyan of the field names of the zerolog.ConsoleWriter
+			name = "\x1b[36m" + name + "\x1b[0m"
+		}
+		lead = append(lead, fmt.Sprintf("%s%v", name, v))
+	}
+	if len(lead) == 0 {
+		return p, ""
+	}
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return p, ""
+	}
+	return b, strings.Join(lead, " ")
+}
+
+// separatorWriter replaces the trailing newline of every record with sep.
+type separatorWriter struct {
+	w   io.Writer
+	sep byte
+}
+
+func (s separatorWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s separatorWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	n := len(p)
+	if n == 0 || p[n-1] != '\n' {
+		return writeLevel(s.w, level, p)
+	}
+	// copy the record to write it with a single call
+	b := make([]byte, n)
+	copy(b, p)
+	b[n-1] = s.sep
+	if _, err := writeLevel(s.w, level, b); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// logfmtWriter transcodes JSON records to logfmt, keeping the order of the
+// fields. Records that are not a JSON object are written unchanged.
+type logfmtWriter struct {
+	w io.Writer
+}
+
+func (lw logfmtWriter) Write(p []byte) (int, error) {
+	return lw.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (lw logfmtWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	b, err := logfmt(p)
+	if err != nil {
+		return writeLevel(lw.w, level, p)
+	}
+	if _, err := writeLevel(lw.w, level, b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+var errNotObject = errors.New("record is not a JSON object")
+
+// logfmt returns the top level fields of the JSON object p as key=value pairs
+// terminated by a newline. Nested objects and arrays are written as quoted JSON.
+func logfmt(p []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, errNotObject
+	}
+	var buf bytes.Buffer
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(t.(string))
+		buf.WriteByte('=')
+		switch raw[0] {
+		case '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, err
+			}
+			buf.WriteString(logfmtQuote(s))
+		case '{', '[':
+			var c bytes.Buffer
+			if err := json.Compact(&c, raw); err != nil {
+				return nil, err
+			}
+			buf.WriteString(strconv.Quote(c.String()))
+		default:
+			buf.Write(raw)
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// logfmtQuote quotes s if it is empty or contains spaces, quotes, '=' or
+// control characters.
+func logfmtQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"") || strings.IndexFunc(s, func(r rune) bool {
+		return r < ' ' || r == 0x7f
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// ringBuffer keeps copies of the most recently written records.
+type ringBuffer struct {
+	mu      sync.Mutex
+	records [][]byte
+	next    int
+	full    bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{records: make([][]byte, size)}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+	r.mu.Lock()
+	r.records[r.next] = b
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+	return len(p), nil
+}
+
+// dump returns the records, oldest first.
+func (r *ringBuffer) dump() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([][]byte(nil), r.records[:r.next]...)
+	}
+	out := make([][]byte, 0, len(r.records))
+	out = append(out, r.records[r.next:]...)
+	return append(out, r.records[:r.next]...)
+}
+
+// onLogWriter passes every record to fn after writing it to w.
+type onLogWriter struct {
+	w  io.Writer
+	fn func(level zerolog.Level, record []byte)
+}
+
+func (o onLogWriter) Write(p []byte) (int, error) {
+	return o.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (o onLogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	n, err := writeLevel(o.w, level, p)
+	o.fn(level, p)
+	return n, err
+}
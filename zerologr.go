@@ -18,8 +18,26 @@
 package zerologr
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-logr/logr"
 	"github.com/rs/zerolog"
@@ -28,6 +46,81 @@ import (
 const debugVerbosity = 2
 const traceVerbosity = 8
 
+// LevelMap maps logr verbosity levels to zerolog levels. Use Thresholds to
+// create a validated LevelMap. The zero LevelMap uses the default thresholds,
+// see Options.Levels.
+type LevelMap struct {
+	base  zerolog.Level
+	debug int
+	trace int
+}
+
+// Thresholds returns a LevelMap that logs verbosities below debug at
+// zerolog.InfoLevel (see WithBase), verbosities below trace at zerolog.DebugLevel and all
+// others at zerolog.TraceLevel. Both thresholds must not be negative and debug
+// must be lower than trace.
+func Thresholds(debug, trace int) (*LevelMap, error) {
+	if debug < 0 || trace < 0 {
+		return nil, errors.New("verbosity thresholds must not be negative")
+	}
+	if debug >= trace {
+		return nil, errors.New("debug verbosity threshold must be lower than trace threshold")
+	}
+	return &LevelMap{base: zerolog.InfoLevel, debug: debug, trace: trace}, nil
+}
+
+// WithBase returns a copy of the LevelMap that logs verbosities below the
+// debug threshold at the given level instead of zerolog.InfoLevel, e.g. to
+// demote the output of a noisy library to zerolog.WarnLevel.
+func (m *LevelMap) WithBase(lvl zerolog.Level) *LevelMap {
+	out := *m.orDefault()
+	out.base = lvl
+	return &out
+}
+
+// defaultLevels holds the default thresholds, it is used for the zero LevelMap
+var defaultLevels = LevelMap{base: zerolog.InfoLevel, debug: debugVerbosity, trace: traceVerbosity}
+
+// globalLevels holds the *LevelMap used when no LevelMap was passed in the Options
+var globalLevels atomic.Value
+
+func init() {
+	levels := defaultLevels
+	globalLevels.Store(&levels)
+}
+
+// SetGlobalThresholds changes the verbosity thresholds of all loggers that
+// were created without Options.Levels. It can be called at runtime, e.g. from
+// a signal handler to enable debug logging.
+func SetGlobalThresholds(debug, trace int) error {
+	m, err := Thresholds(debug, trace)
+	if err != nil {
+		return err
+	}
+	globalLevels.Store(m)
+	return nil
+}
+
+// orDefault returns m, or the defaultLevels if m is the zero LevelMap. The
+// trace threshold of a LevelMap created by Thresholds is always positive.
+func (m *LevelMap) orDefault() *LevelMap {
+	if m.trace == 0 {
+		return &defaultLevels
+	}
+	return m
+}
+
+// level returns the zerolog level for the given verbosity.
+func (m *LevelMap) level(verbosity int) zerolog.Level {
+	m = m.orDefault()
+	if verbosity < m.debug {
+		return m.base
+	} else if verbosity < m.trace {
+		return zerolog.DebugLevel
+	}
+	return zerolog.TraceLevel
+}
+
 // New returns a logr.Logger which is implemented by zerolog.
 func New() logr.Logger {
 	return NewWithOptions(Options{})
@@ -35,34 +128,378 @@ func New() logr.Logger {
 
 // NewWithOptions returns a logr.Logger which is implemented by zerolog.
 func NewWithOptions(opts Options) logr.Logger {
+	timestamp := false
+	var ring *ringBuffer
 	if opts.Logger == nil {
-		l := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		w := opts.Writer
+		if w == nil {
+			w = os.Stderr
+		}
+		if opts.RecordSeparator != 0 && opts.RecordSeparator != '\n' {
+			w = separatorWriter{w: w, sep: opts.RecordSeparator}
+		}
+		switch opts.Format {
+		case FormatConsole:
+			w = consoleWriter{cw: zerolog.ConsoleWriter{Out: w}}
+		case FormatLogfmt:
+			w = logfmtWriter{w: w}
+		}
+		if opts.RingBufferSize > 0 {
+			ring = newRingBuffer(opts.RingBufferSize)
+			w = zerolog.MultiLevelWriter(w, ring)
+		}
+		if opts.OnLog != nil {
+			w = onLogWriter{w: w, fn: opts.OnLog}
+		}
+		// the timestamp is added by send so InfoAt can override it
+		l := zerolog.New(w)
+		opts.Logger = &l
+		timestamp = true
+	}
+	if opts.SchemaVersion != "" {
+		l := opts.Logger.With().Str("schema_version", opts.SchemaVersion).Logger()
+		opts.Logger = &l
+	}
+	if opts.WithBuildInfo {
+		c := opts.Logger.With().Str("go_version", runtime.Version())
+		if rev := vcsRevision(); rev != "" {
+			c = c.Str("commit", rev)
+		}
+		l := c.Logger()
+		opts.Logger = &l
+	}
+	if opts.DetectTestEnv && runningTests() {
+		l := opts.Logger.With().Str("env", "test").Logger()
+		opts.Logger = &l
+	}
+	if opts.GenerateLoggerID {
+		l := opts.Logger.With().Str("logger_id", newLoggerID()).Logger()
+		opts.Logger = &l
+	}
+	if opts.GoroutineID {
+		l := opts.Logger.Hook(goroutineIDHook)
 		opts.Logger = &l
 	}
+	if opts.WithUptime {
+		start := time.Now()
+		l := opts.Logger.Hook(zerolog.HookFunc(func(e *zerolog.Event, _ zerolog.Level, _ string) {
+			// time.Since uses the monotonic clock reading of start
+			e.Int64("uptime_ms", time.Since(start).Milliseconds())
+		}))
+		opts.Logger = &l
+	}
+	var ringLog *zerolog.Logger
+	if ring != nil && !opts.DryRun {
+		// records that are not written because of their level are encoded
+		// into the ring buffer by the ringLog
+		rl := opts.Logger.Output(ring)
+		ringLog = &rl
+	}
+	if opts.DryRun {
+		l := opts.Logger.Output(io.Discard)
+		opts.Logger = &l
+	}
+	var dedup *errorDedup
+	if opts.ErrorDedupWindow > 0 {
+		dedup = newErrorDedup(opts.ErrorDedupWindow)
+	}
 	return logger{
 		l:         opts.Logger,
-		verbosity: 0,
+		opts:      &opts,
+		dedup:     dedup,
+		timestamp: timestamp,
+		ring:      ring,
+		ringLog:   ringLog,
+		verbosity: opts.clampVerbosity(opts.Verbosity),
 		prefix:    opts.Name,
 		values:    nil,
 	}
 }
 
+// runningTests returns true if the program was started by go test, which
+// passes -test. flags to the test binary.
+func runningTests() bool {
+	for _, arg := range os.Args[1:] {
+		if strings.HasPrefix(arg, "-test.") {
+			return true
+		}
+	}
+	return false
+}
+
+// newLoggerID returns a random version 4 UUID.
+func newLoggerID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Format selects how the default logger formats records.
+type Format int
+
+const (
+	// FormatJSON writes records as JSON, this is the default
+	FormatJSON Format = iota
+	// FormatConsole writes human readable records using a zerolog.ConsoleWriter
+	FormatConsole
+	// FormatLogfmt writes records as logfmt key=value pairs, values containing
+	// spaces are quoted
+	FormatLogfmt
+)
+
 // Options that can be passed to NewWithOptions
 type Options struct {
 	// Name is an optional name of the logger
 	Name string
 	// Logger is an instance of zerolog, if nil a default logger is used
 	Logger *zerolog.Logger
+	// Writer is used by the default logger if Logger is nil, defaults to os.Stderr
+	Writer io.Writer
+	// Closer is flushed and closed by Shutdown instead of flushing Writer, e.g.
+	// the async writer used by Logger. Writer is never closed
+	Closer io.Closer
+	// Format of the records written by the default logger if Logger is nil
+	Format Format
+	// RingBufferSize keeps the given number of the most recent records of the
+	// default logger in memory, see DumpRing. This includes records that are
+	// not written because their level is below the global zerolog level or
+	// the verbosity is not enabled, but not records dropped by MinLevel. The
+	// Filter, Sampler and ErrorDedupWindow only apply to written records, Lazy
+	// values are omitted from the other records
+	RingBufferSize int
+	// OnLog is called synchronously with every record written by the default
+	// logger, after it has been written. The record must not be retained
+	OnLog func(level zerolog.Level, record []byte)
+	// RecordSeparator replaces the newline written after every record by the
+	// default logger if Logger is nil
+	RecordSeparator byte
+	// Verbosity is the initial verbosity of the logger
+	Verbosity int
+	// MinLevel drops non-error records whose level, after mapping the
+	// verbosity, is below it, e.g. zerolog.DebugLevel drops trace records. If
+	// nil no records are dropped
+	MinLevel *zerolog.Level
+	// SyncZerologLevel makes V derive a zerolog logger with the level mapped
+	// from the verbosity if it is higher than the level of the zerolog logger,
+	// see Zerolog
+	SyncZerologLevel bool
+	// MaxVerbosity caps Verbosity and the verbosity passed to V, 0 means
+	// unbounded
+	MaxVerbosity int
+	// Levels maps verbosity levels to zerolog levels, if nil the global
+	// thresholds are used, see SetGlobalThresholds. By default verbosities below
+	// 2 are logged as info, below 8 as debug and all others as trace
+	Levels *LevelMap
+	// GoroutineID adds the id of the logging goroutine as goid to every record.
+	// The id is parsed from a stack trace for every event, so this is costly
+	// and only meant for debugging
+	GoroutineID bool
+	// TimestampPrecision truncates the timestamp added by the default logger to
+	// the given duration and formats it with RFC 3339 and as many fractional
+	// digits as needed, e.g. 6 for time.Microsecond. If 0 the timestamp is
+	// formatted with zerolog.TimeFieldFormat
+	TimestampPrecision time.Duration
+	// WithUptime adds the milliseconds elapsed since NewWithOptions was called
+	// as uptime_ms to every record
+	WithUptime bool
+	// SchemaVersion is added as schema_version to every record if not empty
+	SchemaVersion string
+	// WithBuildInfo adds the go_version and, if the binary was built with vcs
+	// information by Go 1.18 or later, the commit to every record
+	WithBuildInfo bool
+	// Filter is consulted before a record is built. It receives the bound values
+	// followed by the key-value pairs of the call, returning false drops the record
+	Filter func(level zerolog.Level, msg string, kv []interface{}) bool
+	// InternalStacks adds a stack trace to the errors logged for invalid
+	// key-value pairs
+	InternalStacks bool
+	// MessageFieldName is used instead of zerolog.MessageFieldName for the
+	// message if not empty. zerolog hooks will then receive an empty message
+	MessageFieldName string
+	// SpanContextFields returns key-value pairs to add to records logged with
+	// InfoContext and ErrorContext, e.g. the trace_id and span_id of the
+	// active span
+	SpanContextFields func(ctx context.Context) []interface{}
+	// SpanFromContext returns the span context used by WithSpanContext, e.g. by
+	// converting the result of trace.SpanContextFromContext of OpenTelemetry
+	SpanFromContext func(ctx context.Context) SpanContext
+	// ErrorFlag adds is_error to every record, true for Error and false for Info
+	ErrorFlag bool
+	// AlwaysMarkErrors adds status with the value error to every record logged
+	// with Error, so they can be identified even if the error is nil
+	AlwaysMarkErrors bool
+	// ErrorTypeField is the key used to add the type of the error to records
+	// logged with Error, if empty the type is not added
+	ErrorTypeField string
+	// ErrorSignature adds the error message with UUIDs and numbers replaced by
+	// placeholders as error_signature, so similar errors can be grouped
+	ErrorSignature bool
+	// ErrorChainObjects adds the error and the errors it wraps, as returned by
+	// errors.Unwrap, as error_chain array of objects with message and type
+	ErrorChainObjects bool
+	// ErrorDedupWindow suppresses Error calls of loggers with the same name
+	// with the same message and error text within the window. The number of
+	// suppressed records is added as suppressed to the next record that is
+	// logged
+	ErrorDedupWindow time.Duration
+	// DetectTestEnv adds env with the value test to every record if the program
+	// is a test binary run by go test
+	DetectTestEnv bool
+	// GenerateLoggerID adds a random logger_id to every record, shared by all
+	// loggers derived from the one returned by NewWithOptions
+	GenerateLoggerID bool
+	// CompactVerbosity omits the verbosity field for records logged at V(0)
+	CompactVerbosity bool
+	// RedactURLCredentials replaces the password of logged url.URL values with xxxxx
+	RedactURLCredentials bool
+	// DryRun validates the bound values and key-value pairs of every call,
+	// regardless of the level, and passes errors to OnInternalError instead of
+	// writing records, e.g. to check the logging calls of a test suite. Fatal
+	// does not exit
+	DryRun bool
+	// OnInternalError is called with errors caused by invalid key-value pairs
+	// and by flushing the Writer for FlushOnError
+	OnInternalError func(err error)
+	// ExitCode is used by Fatal to exit the program, defaults to 1
+	ExitCode int
+	// Exit is called by Fatal with the ExitCode, defaults to os.Exit
+	Exit func(code int)
+	// FlushOnError flushes the Writer after every record logged with Error, if
+	// it implements Flush() error like a bufio.Writer
+	FlushOnError bool
+	// ValidateWithValues makes WithValues check the key-value pairs right away
+	// instead of when a record is logged. Errors are passed to OnInternalError,
+	// the records logged with the values still get a zerologr-err field
+	ValidateWithValues bool
+	// PanicOnInvalidValues makes WithValues panic with the error instead for
+	// ValidateWithValues, e.g. in tests
+	PanicOnInvalidValues bool
+	// OmitZeroStructFields makes WithStruct skip fields with a zero value
+	OmitZeroStructFields bool
+	// AssumeTypedFields skips the validation of key-value pairs for hot paths.
+	// This is unsafe: a trailing key without a value is silently dropped and a
+	// non-string key causes a panic. Only use it for benchmarked call sites
+	AssumeTypedFields bool
+	// ErrorVerbose adds the %+v form of errors implementing fmt.Formatter, e.g.
+	// the stack trace of github.com/pkg/errors, as detail
+	ErrorVerbose bool
+	// Caller adds the file:line of the call site to every record
+	Caller bool
+	// CallerFunc adds the fully qualified name of the calling function as func
+	// to records with a caller
+	CallerFunc bool
+	// SourceURLTemplate adds a source_url to records with a caller, built by
+	// replacing {file} and {line} in the template with the file and line of
+	// the call site, e.g. https://example.com/blob/main/{file}#L{line}. Build
+	// with -trimpath to get file paths starting with the module path
+	SourceURLTemplate string
+	// CallerLevels restricts Caller to records logged at the listed levels, if
+	// empty the caller is added at all levels
+	CallerLevels []zerolog.Level
+	// Module adds the package path of the calling function as module to every
+	// record
+	Module bool
+	// PreHook is called before the fields of a record are added
+	PreHook func(level zerolog.Level)
+	// PostHook is called after a record has been written
+	PostHook func(level zerolog.Level)
+	// SanitizeName makes WithName replace '/' characters in a name with '_'
+	SanitizeName bool
+	// MaxFields limits the number of key-value pairs of a record, including the
+	// bound values. Further pairs are dropped and truncated and dropped_fields
+	// are added. 0 means unlimited
+	MaxFields int
+	// MaxStringLen truncates string values longer than the given number of
+	// bytes and appends …(truncated). 0 means unlimited
+	MaxStringLen int
+	// FieldOrder lists keys of the bound values and key-value pairs that are
+	// added before all other pairs, in the given order. Missing keys are skipped
+	FieldOrder []string
+	// NestUserFields adds the bound values and the key-value pairs of a call as
+	// an object with the given key instead of top level fields
+	NestUserFields string
+	// NumericEnums logs named integer types implementing fmt.Stringer, like
+	// time.Month, as numbers instead of by their name
+	NumericEnums bool
+	// NumericLevel adds the zerolog level as a number as levelnum to every
+	// record, e.g. 0 for debug and 1 for info
+	NumericLevel bool
+	// GCPSeverity adds the Google Cloud Logging severity matching the level as
+	// severity to every record
+	GCPSeverity bool
+	// Fingerprint adds a hash of the message and the sorted keys of the bound
+	// values and key-value pairs as fingerprint, so records with the same
+	// structure share a fingerprint regardless of their values
+	Fingerprint bool
+	// MarkDerived adds derived to records logged with a non-zero verbosity
+	MarkDerived bool
+	// BoolAsString logs bool values as TrueString and FalseString
+	BoolAsString bool
+	// TrueString is used for true with BoolAsString, defaults to enabled
+	TrueString string
+	// FalseString is used for false with BoolAsString, defaults to disabled
+	FalseString string
+	// Sampler samples the non-error records, logged with Info or helpers like
+	// InfoWith and Warn, that are not kept by SampleByField. If nil all records
+	// are logged
+	Sampler zerolog.Sampler
+	// SampleByField exempts records from the Sampler if Keep returns true for
+	// the value of Key, taken from keysAndVals of the call or the bound values.
+	// Keep receives nil if the key is missing
+	SampleByField struct {
+		Key  string
+		Keep func(val interface{}) bool
+	}
 }
 
-// logger is a logr.Logger that uses zerolog to log.
+// clampVerbosity returns the verbosity capped to MaxVerbosity.
+func (o *Options) clampVerbosity(verbosity int) int {
+	if o.MaxVerbosity > 0 && verbosity > o.MaxVerbosity {
+		return o.MaxVerbosity
+	}
+	return verbosity
+}
+
+// logger is a logr.Logger that uses zerolog to log. Derived loggers share the
+// zerolog logger and options, which are never modified after construction, and
+// the internally synchronized dedup and ring state, so they can be used
+// concurrently.
 type logger struct {
-	l         *zerolog.Logger
+	l     *zerolog.Logger
+	opts  *Options
+	dedup *errorDedup
+	// fixed is set by AtLevel to log at fixedLevel regardless of the verbosity
+	fixed      bool
+	fixedLevel zerolog.Level
+	// timestamp adds the current time to every record
+	timestamp bool
+	ring      *ringBuffer
+	// ringLog adds records to the ring that are not written because of their
+	// level, it is nil if there is no ring buffer
+	ringLog *zerolog.Logger
+	// ringOnly is set while building a record that is only added to the ring
+	// buffer, Lazy values are skipped for it
+	ringOnly  bool
 	verbosity int
 	prefix    string
-	values    []interface{}
+	// msgPrefix is prepended to every message, see WithMessagePrefix
+	msgPrefix string
+	// memStats adds heap_alloc_bytes, see WithMemStats
+	memStats bool
+	// buckets are the sorted latency bucket boundaries, see WithLatencyBuckets
+	buckets []time.Duration
+	// labels are added as the labels object, see WithLabel. The map is
+	// copied by WithLabel and never modified afterwards
+	labels map[string]string
+	values []interface{}
 }
 
+// clone returns a copy of l. The values are copied into a slice without spare
+// capacity, so appending to them never writes to the backing array of l.
 func (l logger) clone() logger {
 	out := l
 	out.values = copySlice(l.values)
@@ -75,14 +512,38 @@ func copySlice(in []interface{}) []interface{} {
 	return out
 }
 
+var (
+	errOddArguments = errors.New("odd number of arguments passed as key-value pairs for logging")
+	errNonStringKey = errors.New("non-string key argument passed to logging, ignoring all later arguments")
+)
+
+// validate checks that keysAndVals consists of pairs with string keys.
+func validate(keysAndVals []interface{}) error {
+	if len(keysAndVals)%2 != 0 {
+		return errOddArguments
+	}
+	for i := 0; i < len(keysAndVals); i += 2 {
+		if _, isString := keysAndVals[i].(string); !isString {
+			return errNonStringKey
+		}
+	}
+	return nil
+}
+
 // add converts a bunch of arbitrary key-value pairs into zerolog fields.
-func add(e *zerolog.Event, keysAndVals []interface{}) {
+func (l logger) add(e *zerolog.Event, keysAndVals []interface{}) {
+	keysAndVals = l.expandAttrs(keysAndVals)
+	if l.opts.AssumeTypedFields {
+		for i := 0; i+1 < len(keysAndVals); i += 2 {
+			l.addValue(e, keysAndVals[i].(string), keysAndVals[i+1])
+		}
+		return
+	}
 
 	// make sure we got an even number of arguments
 	if len(keysAndVals)%2 != 0 {
-		e.Interface("args", keysAndVals).
-			AnErr("zerologr-err", errors.New("odd number of arguments passed as key-value pairs for logging")).
-			Stack()
+		e.Interface("args", keysAndVals)
+		l.internalError(e, errOddArguments)
 		return
 	}
 
@@ -93,72 +554,763 @@ func add(e *zerolog.Event, keysAndVals []interface{}) {
 		keyStr, isString := key.(string)
 		if !isString {
 			// if the key isn't a string, log additional error
-			e.Interface("invalid key", key).
-				AnErr("zerologr-err", errors.New("non-string key argument passed to logging, ignoring all later arguments")).
-				Stack()
+			e.Interface("invalid key", key)
+			l.internalError(e, errNonStringKey)
 			return
 		}
-		e.Interface(keyStr, val)
+		l.addValue(e, keyStr, val)
 
 		i += 2
 	}
 }
 
-func (l logger) Info(msg string, keysAndVals ...interface{}) {
-	if l.Enabled() {
-		var e *zerolog.Event
-		if l.verbosity < debugVerbosity {
-			e = l.l.Info()
-		} else if l.verbosity < traceVerbosity {
-			e = l.l.Debug()
+// boolString returns TrueString or FalseString, defaulting to enabled and
+// disabled.
+func (l logger) boolString(b bool) string {
+	if b {
+		if l.opts.TrueString != "" {
+			return l.opts.TrueString
+		}
+		return "enabled"
+	}
+	if l.opts.FalseString != "" {
+		return l.opts.FalseString
+	}
+	return "disabled"
+}
+
+// truncate shortens s to MaxStringLen bytes without splitting a rune.
+func (l logger) truncate(s string) string {
+	limit := l.opts.MaxStringLen
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit] + "…(truncated)"
+}
+
+// urlString returns the string form of u, with the password redacted if
+// RedactURLCredentials is set.
+func (l logger) urlString(u *url.URL) string {
+	if l.opts.RedactURLCredentials {
+		return u.Redacted()
+	}
+	return u.String()
+}
+
+// addFields adds the labels, the bound values, the fields set with
+// SetLocalFields and keysAndVals to the event. The values are nested under
+// NestUserFields if set. If there are more than MaxFields pairs the rest is
+// dropped.
+func (l logger) addFields(e *zerolog.Event, keysAndVals []interface{}) {
+	if len(l.labels) > 0 {
+		keys := make([]string, 0, len(l.labels))
+		for k := range l.labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := zerolog.Dict()
+		for _, k := range keys {
+			d.Str(k, l.labels[k])
+		}
+		e.Dict("labels", d)
+	}
+	values := l.values
+	if local := localValues(); local != nil {
+		values = append(copySlice(values), local...)
+	}
+	dropped := 0
+	if limit := l.opts.MaxFields; limit > 0 && len(values)/2+len(keysAndVals)/2 > limit {
+		dropped = len(values)/2 + len(keysAndVals)/2 - limit
+		if len(values)/2 >= limit {
+			values, keysAndVals = values[:2*limit], nil
 		} else {
-			e = l.l.Trace()
+			keysAndVals = keysAndVals[:2*(limit-len(values)/2)]
 		}
-		e.Int("verbosity", l.verbosity)
-		if l.prefix != "" {
-			e.Str("name", l.prefix)
+	}
+	if len(l.opts.FieldOrder) > 0 {
+		kv := l.expandAttrs(append(copySlice(values), keysAndVals...))
+		if validate(kv) == nil {
+			values, keysAndVals = orderFields(l.opts.FieldOrder, kv), nil
 		}
-		add(e, l.values)
-		add(e, keysAndVals)
+	}
+	if l.opts.NestUserFields != "" {
+		d := zerolog.Dict()
+		l.add(d, values)
+		l.add(d, keysAndVals)
+		e.Dict(l.opts.NestUserFields, d)
+	} else {
+		l.add(e, values)
+		l.add(e, keysAndVals)
+	}
+	if dropped > 0 {
+		e.Bool("truncated", true).Int("dropped_fields", dropped)
+	}
+}
+
+// orderFields returns the key-value pairs with the keys listed in order first,
+// in that order, followed by the other pairs.
+func orderFields(order []string, keysAndVals []interface{}) []interface{} {
+	out := make([]interface{}, 0, len(keysAndVals))
+	used := make([]bool, len(keysAndVals)/2)
+	for _, key := range order {
+		for i := 0; i < len(keysAndVals); i += 2 {
+			if !used[i/2] && keysAndVals[i] == key {
+				out = append(out, keysAndVals[i], keysAndVals[i+1])
+				used[i/2] = true
+			}
+		}
+	}
+	for i := 0; i < len(keysAndVals); i += 2 {
+		if !used[i/2] {
+			out = append(out, keysAndVals[i], keysAndVals[i+1])
+		}
+	}
+	return out
+}
+
+// internalError adds an error caused by invalid logging arguments to the event.
+// With InternalStacks the stack is added using the zerolog.ErrorStackMarshaler,
+// or as a plain runtime stack trace if no marshaler is configured.
+func (l logger) internalError(e *zerolog.Event, err error) {
+	e.AnErr("zerologr-err", err)
+	if l.opts.OnInternalError != nil {
+		l.opts.OnInternalError(err)
+	}
+	if !l.opts.InternalStacks {
+		return
+	}
+	if zerolog.ErrorStackMarshaler != nil {
+		e.Interface(zerolog.ErrorStackFieldName, zerolog.ErrorStackMarshaler(err))
+		return
+	}
+	buf := make([]byte, 4096)
+	e.Str(zerolog.ErrorStackFieldName, string(buf[:runtime.Stack(buf, false)]))
+}
+
+// Redactable is implemented by values that carry secrets. zerologr logs the
+// value returned by Redact instead of the value itself.
+type Redactable interface {
+	Redact() interface{}
+}
+
+// Marshaler is implemented by values that provide their own representation for
+// logging, like the Marshaler of newer logr versions. zerologr logs the value
+// returned by MarshalLog instead of the value itself. This avoids depending on
+// the protobuf runtime for gRPC messages: a wrapper type can return the output
+// of protojson.Marshal as json.RawMessage to log a message as JSON instead of
+// its generated struct fields.
+type Marshaler interface {
+	MarshalLog() interface{}
+}
+
+// addValue adds a single value to the event, using a typed encoder where zerolog
+// would otherwise produce an unexpected representation.
+func (l logger) addValue(e *zerolog.Event, key string, val interface{}) {
+	if r, ok := val.(Redactable); ok {
+		val = r.Redact()
+	}
+	if m, ok := val.(Marshaler); ok {
+		val = m.MarshalLog()
+	}
+	switch v := val.(type) {
+	case lazyValue:
+		if e.Enabled() && !l.ringOnly {
+			l.addValue(e, key, v())
+		}
+	case string:
+		e.Str(key, l.truncate(v))
+	case bool:
+		if l.opts.BoolAsString {
+			e.Str(key, l.boolString(v))
+		} else {
+			e.Bool(key, v)
+		}
+	case json.Number:
+		// emit the number unquoted, json.Marshal validates the literal
+		if b, err := json.Marshal(v); err == nil {
+			e.RawJSON(key, b)
+		} else {
+			e.Str(key, string(v))
+		}
+	case *url.URL:
+		if v == nil {
+			e.Interface(key, nil)
+		} else {
+			e.Str(key, l.urlString(v))
+		}
+	case url.URL:
+		e.Str(key, l.urlString(&v))
+	case context.Context:
+		// do not leak the values or internals of a context
+		e.Str(key, "<context.Context>")
+	// reflect values and types would be logged by their internals
+	case reflect.Value:
+		if v.IsValid() {
+			e.Str(key, v.Type().String())
+		} else {
+			e.Str(key, "<invalid reflect.Value>")
+		}
+	case reflect.Type:
+		e.Str(key, v.String())
+	case []string:
+		e.Strs(key, v)
+	case []error:
+		// Errs honors the zerolog.ErrorMarshalFunc
+		e.Errs(key, v)
+	case *time.Time:
+		if v == nil {
+			e.Interface(key, nil)
+		} else {
+			e.Time(key, *v)
+		}
+	// emit the value of sql.Null types, or null if it is not valid
+	case sql.NullString:
+		if v.Valid {
+			e.Str(key, v.String)
+		} else {
+			e.Interface(key, nil)
+		}
+	case sql.NullInt64:
+		if v.Valid {
+			e.Int64(key, v.Int64)
+		} else {
+			e.Interface(key, nil)
+		}
+	case sql.NullInt32:
+		if v.Valid {
+			e.Int32(key, v.Int32)
+		} else {
+			e.Interface(key, nil)
+		}
+	case sql.NullFloat64:
+		if v.Valid {
+			e.Float64(key, v.Float64)
+		} else {
+			e.Interface(key, nil)
+		}
+	case sql.NullBool:
+		if v.Valid {
+			e.Bool(key, v.Bool)
+		} else {
+			e.Interface(key, nil)
+		}
+	case sql.NullTime:
+		if v.Valid {
+			e.Time(key, v.Time)
+		} else {
+			e.Interface(key, nil)
+		}
+	case time.Duration:
+		e.Dur(key, v)
+		if key == "duration" && len(l.buckets) > 0 {
+			e.Str("bucket", l.bucket(v))
+		}
+	default:
+		switch reflect.ValueOf(val).Kind() {
+		// channels and funcs cannot be marshaled to JSON
+		case reflect.Chan:
+			e.Str(key, "<chan>")
+		case reflect.Func:
+			e.Str(key, "<func>")
+		// named ints like time.Month are logged by their name
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if s, ok := val.(fmt.Stringer); ok && !l.opts.NumericEnums && !marshalsJSON(val) {
+				e.Str(key, s.String())
+			} else {
+				e.Interface(key, val)
+			}
+		// JSON objects only have string keys
+		case reflect.Map:
+			if rv := reflect.ValueOf(val); rv.Type().Key().Kind() != reflect.String && !rv.IsNil() && !marshalsJSON(val) {
+				e.Array(key, l.mapPairs(rv))
+			} else {
+				e.Interface(key, val)
+			}
+		// byte arrays like a UUID would be logged as an array of numbers
+		case reflect.Array:
+			if s, ok := val.(fmt.Stringer); ok && reflect.TypeOf(val).Elem().Kind() == reflect.Uint8 && !marshalsJSON(val) {
+				e.Str(key, s.String())
+			} else {
+				e.Interface(key, val)
+			}
+		default:
+			e.Interface(key, val)
+		}
+	}
+}
+
+// bucket returns the smallest bucket boundary that is not lower than d, or +Inf.
+func (l logger) bucket(d time.Duration) string {
+	i := sort.Search(len(l.buckets), func(i int) bool { return l.buckets[i] >= d })
+	if i == len(l.buckets) {
+		return "+Inf"
+	}
+	return l.buckets[i].String()
+}
+
+// marshalsJSON returns true if json.Marshal uses a custom encoding for val.
+func marshalsJSON(val interface{}) bool {
+	switch val.(type) {
+	case json.Marshaler, encoding.TextMarshaler:
+		return true
+	}
+	return false
+}
+
+// mapPair is a map entry logged as an object with a key and a value.
+type mapPair struct {
+	l          logger
+	key, value interface{}
+}
+
+func (p mapPair) MarshalZerologObject(e *zerolog.Event) {
+	p.l.addValue(e, "key", p.key)
+	p.l.addValue(e, "value", p.value)
+}
+
+// mapPairs returns the entries of the map m as an array of key and value
+// objects, sorted by key if the keys are numbers.
+func (l logger) mapPairs(m reflect.Value) *zerolog.Array {
+	keys := m.MapKeys()
+	switch m.Type().Key().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Uint() < keys[j].Uint() })
+	case reflect.Float32, reflect.Float64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Float() < keys[j].Float() })
+	}
+	a := zerolog.Arr()
+	for _, k := range keys {
+		a.Object(mapPair{l: l, key: k.Interface(), value: m.MapIndex(k).Interface()})
+	}
+	return a
+}
+
+// level returns the zerolog level for the verbosity of the logger.
+func (l logger) level() zerolog.Level {
+	if l.fixed {
+		return l.fixedLevel
+	}
+	m := l.opts.Levels
+	if m == nil {
+		m = globalLevels.Load().(*LevelMap)
+	}
+	return m.level(l.verbosity)
+}
+
+// filtered returns true if the Filter option drops the record.
+func (l logger) filtered(lvl zerolog.Level, msg string, keysAndVals []interface{}) bool {
+	if l.opts.Filter == nil {
+		return false
+	}
+	kv := append(copySlice(l.values), keysAndVals...)
+	return !l.opts.Filter(lvl, msg, kv)
+}
+
+// addTime adds t as the timestamp, with TimestampPrecision if set.
+func (l logger) addTime(e *zerolog.Event, t time.Time) {
+	p := l.opts.TimestampPrecision
+	if p <= 0 {
+		e.Time(zerolog.TimestampFieldName, t)
+		return
+	}
+	layout := time.RFC3339
+	switch {
+	case p < time.Microsecond:
+		layout = "2006-01-02T15:04:05.000000000Z07:00"
+	case p < time.Millisecond:
+		layout = "2006-01-02T15:04:05.000000Z07:00"
+	case p < time.Second:
+		layout = "2006-01-02T15:04:05.000Z07:00"
+	}
+	e.Str(zerolog.TimestampFieldName, t.Truncate(p).Format(layout))
+}
+
+// send adds the message to the event and writes it.
+func (l logger) send(e *zerolog.Event, msg string) {
+	msg = l.msgPrefix + msg
+	if l.timestamp {
+		l.addTime(e, zerolog.TimestampFunc())
+	}
+	if l.opts.MessageFieldName == "" {
 		e.Msg(msg)
+		return
+	}
+	if msg != "" {
+		e.Str(l.opts.MessageFieldName, msg)
 	}
+	e.Msg("")
 }
 
-func (l logger) Enabled() bool {
-	var lvl zerolog.Level
-	if l.verbosity < debugVerbosity {
-		lvl = zerolog.InfoLevel
-	} else if l.verbosity < traceVerbosity {
-		lvl = zerolog.DebugLevel
-	} else {
-		lvl = zerolog.TraceLevel
+// Info logs a non-error message. The name and verbosity are the first fields
+// after the level and the fields of the zerolog context, followed by the other
+// fields added by zerologr, the bound values and keysAndVals. With
+// FormatConsole the name and verbosity are written right before the message
+// and the other fields are sorted alphabetically by the zerolog.ConsoleWriter.
+func (l logger) Info(msg string, keysAndVals ...interface{}) {
+	if l.recorded() {
+		l.log(l.level(), msg, keysAndVals, nil)
+	}
+}
+
+// sampled returns true if the Sampler keeps a non-error record.
+func (l logger) sampled(lvl zerolog.Level, keysAndVals []interface{}) bool {
+	if l.opts.Sampler == nil {
+		return true
+	}
+	if sf := l.opts.SampleByField; sf.Keep != nil && sf.Keep(fieldValue(sf.Key, l.values, keysAndVals)) {
+		return true
+	}
+	return l.opts.Sampler.Sample(lvl)
+}
+
+// fieldValue returns the value of the last pair with the given key, the pairs
+// of keysAndVals take precedence over the bound values.
+func fieldValue(key string, values, keysAndVals []interface{}) interface{} {
+	for _, kv := range [][]interface{}{keysAndVals, values} {
+		for i := len(kv) - len(kv)%2 - 2; i >= 0; i -= 2 {
+			if k, ok := kv[i].(string); ok && k == key {
+				return kv[i+1]
+			}
+		}
+	}
+	return nil
+}
+
+// fingerprint returns the hex encoded FNV-1a hash of the message and the sorted
+// keys of the bound values and keysAndVals.
+func (l logger) fingerprint(msg string, keysAndVals []interface{}) string {
+	var keys []string
+	for _, kv := range [][]interface{}{l.values, keysAndVals} {
+		for i := 0; i+1 < len(kv); i += 2 {
+			if k, ok := kv[i].(string); ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	io.WriteString(h, l.msgPrefix+msg)
+	for _, k := range keys {
+		h.Write([]byte{0})
+		io.WriteString(h, k)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// gcpSeverities maps zerolog levels to Google Cloud Logging severities
+var gcpSeverities = map[zerolog.Level]string{
+	zerolog.TraceLevel: "DEBUG",
+	zerolog.DebugLevel: "DEBUG",
+	zerolog.InfoLevel:  "INFO",
+	zerolog.WarnLevel:  "WARNING",
+	zerolog.ErrorLevel: "ERROR",
+	zerolog.FatalLevel: "CRITICAL",
+	zerolog.PanicLevel: "ALERT",
+}
+
+// addLevelFields adds fields derived from the level of the record.
+func (l logger) addLevelFields(e *zerolog.Event, lvl zerolog.Level) {
+	if l.opts.NumericLevel {
+		e.Int("levelnum", int(lvl))
+	}
+	if l.opts.GCPSeverity {
+		sev, ok := gcpSeverities[lvl]
+		if !ok {
+			sev = "DEFAULT"
+		}
+		e.Str("severity", sev)
 	}
-	if lvl < zerolog.GlobalLevel() {
+}
+
+// log logs a non-error message at the given level, fn is called with the
+// event right before it is written if not nil.
+func (l logger) log(lvl zerolog.Level, msg string, keysAndVals []interface{}, fn func(*zerolog.Event)) {
+	if l.opts.DryRun {
+		l.lint(keysAndVals)
+		return
+	}
+	if l.belowMinLevel(lvl) {
+		return
+	}
+	// records only added to the ring buffer do not use up the Sampler
+	if l.writes(lvl) && (!l.sampled(lvl, keysAndVals) || l.filtered(lvl, msg, keysAndVals)) {
+		return
+	}
+	e, written := l.event(lvl)
+	if e == nil {
+		return
+	}
+	l.ringOnly = !written
+	if written && l.opts.PreHook != nil {
+		l.opts.PreHook(lvl)
+	}
+	if l.prefix != "" {
+		e.Str("name", l.prefix)
+	}
+	if !l.opts.CompactVerbosity || l.verbosity != 0 {
+		e.Int("verbosity", l.verbosity)
+	}
+	if l.opts.MarkDerived && l.verbosity != 0 {
+		e.Bool("derived", true)
+	}
+	l.addLevelFields(e, lvl)
+	if l.opts.ErrorFlag {
+		e.Bool("is_error", false)
+	}
+	l.addCaller(e, lvl)
+	l.addFields(e, keysAndVals)
+	if l.opts.Fingerprint {
+		e.Str("fingerprint", l.fingerprint(msg, keysAndVals))
+	}
+	if l.memStats && e.Enabled() {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		e.Uint64("heap_alloc_bytes", m.HeapAlloc)
+	}
+	if fn != nil {
+		fn(e)
+	}
+	l.send(e, msg)
+	if written && l.opts.PostHook != nil {
+		l.opts.PostHook(lvl)
+	}
+}
+
+func (l logger) Enabled() bool {
+	if lvl := l.level(); lvl < zerolog.GlobalLevel() || l.belowMinLevel(lvl) {
 		return false
 	}
 	return true
 }
 
+// recorded returns true if records at the level of l are written or added to
+// the ring buffer.
+func (l logger) recorded() bool {
+	return l.opts.DryRun || l.Enabled() || l.ringLog != nil
+}
+
+// lint passes the errors of the bound values and keysAndVals to
+// OnInternalError for DryRun.
+func (l logger) lint(keysAndVals []interface{}) {
+	if l.opts.OnInternalError == nil {
+		return
+	}
+	for _, kv := range [][]interface{}{l.values, keysAndVals} {
+		if err := validate(l.expandAttrs(kv)); err != nil {
+			l.opts.OnInternalError(err)
+		}
+	}
+}
+
+// writes returns true if the zerolog logger writes records at lvl, records at
+// other levels are only added to the ring buffer.
+func (l logger) writes(lvl zerolog.Level) bool {
+	return lvl >= l.l.GetLevel() && lvl >= zerolog.GlobalLevel()
+}
+
+// event returns a new event for a record at lvl. If the zerolog logger does
+// not write records at lvl the event adds the record to the ring buffer and
+// written is false, or it is nil if there is no ring buffer.
+func (l logger) event(lvl zerolog.Level) (e *zerolog.Event, written bool) {
+	if e := l.l.WithLevel(lvl); e.Enabled() {
+		return e, true
+	}
+	if l.ringLog == nil {
+		return nil, false
+	}
+	return l.ringLog.Log().Str(zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc(lvl)), false
+}
+
+// belowMinLevel returns true if records at lvl are dropped because of MinLevel.
+func (l logger) belowMinLevel(lvl zerolog.Level) bool {
+	return l.opts.MinLevel != nil && lvl < *l.opts.MinLevel
+}
+
+// Error logs an error with the given message. Like Info, the name is the first
+// field, followed by the error.
 func (l logger) Error(err error, msg string, keysAndVals ...interface{}) {
-	e := l.l.Error().Err(err)
+	l.error(err, msg, keysAndVals, nil)
+}
+
+// error logs an error, fn is called with the event right before it is written
+// if not nil.
+func (l logger) error(err error, msg string, keysAndVals []interface{}, fn func(*zerolog.Event)) {
+	if l.opts.DryRun {
+		l.lint(keysAndVals)
+		return
+	}
+	writes := l.writes(zerolog.ErrorLevel)
+	if writes && l.filtered(zerolog.ErrorLevel, msg, keysAndVals) {
+		return
+	}
+	suppressed := 0
+	if writes && l.dedup != nil {
+		var ok bool
+		if ok, suppressed = l.dedup.allow(l.prefix, l.msgPrefix+msg, err); !ok {
+			return
+		}
+	}
+	e, written := l.event(zerolog.ErrorLevel)
+	if e == nil {
+		return
+	}
+	l.ringOnly = !written
+	if written && l.opts.PreHook != nil {
+		l.opts.PreHook(zerolog.ErrorLevel)
+	}
 	if l.prefix != "" {
 		e.Str("name", l.prefix)
 	}
-	add(e, l.values)
-	add(e, keysAndVals)
-	e.Msg(msg)
+	l.addLevelFields(e, zerolog.ErrorLevel)
+	l.addError(e, err)
+	if l.opts.AlwaysMarkErrors {
+		e.Str("status", "error")
+	}
+	if suppressed > 0 {
+		e.Int("suppressed", suppressed)
+	}
+	if l.opts.ErrorFlag {
+		e.Bool("is_error", true)
+	}
+	l.addCaller(e, zerolog.ErrorLevel)
+	l.addFields(e, keysAndVals)
+	if l.opts.Fingerprint {
+		e.Str("fingerprint", l.fingerprint(msg, keysAndVals))
+	}
+	if l.memStats && e.Enabled() {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		e.Uint64("heap_alloc_bytes", m.HeapAlloc)
+	}
+	if fn != nil {
+		fn(e)
+	}
+	l.send(e, msg)
+	if !written {
+		return
+	}
+	if l.opts.FlushOnError {
+		l.flush()
+	}
+	if l.opts.PostHook != nil {
+		l.opts.PostHook(zerolog.ErrorLevel)
+	}
 }
 
+// flush flushes the Writer if it is buffered.
+func (l logger) flush() {
+	if l.opts.DryRun {
+		return
+	}
+	f, ok := l.opts.Writer.(flusher)
+	if !ok {
+		return
+	}
+	if err := f.Flush(); err != nil && l.opts.OnInternalError != nil {
+		l.opts.OnInternalError(err)
+	}
+}
+
+var (
+	uuidPattern   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	numberPattern = regexp.MustCompile(`0[xX][0-9a-fA-F]+|[0-9]+(\.[0-9]+)?`)
+)
+
+// errorSignature returns msg with UUIDs replaced by <uuid> and decimal and hex
+// numbers replaced by <n>.
+func errorSignature(msg string) string {
+	msg = uuidPattern.ReplaceAllLiteralString(msg, "<uuid>")
+	return numberPattern.ReplaceAllLiteralString(msg, "<n>")
+}
+
+// errorLink is an error of a chain logged as an object with its message and
+// type.
+type errorLink struct {
+	err error
+}
+
+func (c errorLink) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("message", c.err.Error())
+	e.Str("type", fmt.Sprintf("%T", c.err))
+}
+
+// joinedError is implemented by errors created with errors.Join
+type joinedError interface {
+	Unwrap() []error
+}
+
+// addError adds err to the event. Errors implementing json.Marshaler are
+// added in their structured form.
+func (l logger) addError(e *zerolog.Event, err error) {
+	if err == nil {
+		// a nil error adds no error fields, not even for Stack
+		return
+	}
+	if l.opts.ErrorTypeField != "" {
+		e.Str(l.opts.ErrorTypeField, fmt.Sprintf("%T", err))
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		e.Uint64("errno", uint64(errno))
+	}
+	if _, ok := err.(fmt.Formatter); ok && l.opts.ErrorVerbose {
+		e.Str("detail", fmt.Sprintf("%+v", err))
+	}
+	if l.opts.ErrorSignature {
+		e.Str("error_signature", errorSignature(err.Error()))
+	}
+	if l.opts.ErrorChainObjects {
+		a := zerolog.Arr()
+		for link := err; link != nil; link = errors.Unwrap(link) {
+			a.Object(errorLink{link})
+		}
+		e.Array("error_chain", a)
+	}
+	if m, ok := err.(json.Marshaler); ok {
+		if data, mErr := m.MarshalJSON(); mErr == nil && json.Valid(data) {
+			e.RawJSON(zerolog.ErrorFieldName, data)
+			return
+		}
+	}
+	if j, ok := err.(joinedError); ok {
+		// log errors.Join errors as an array instead of newline separated text
+		e.Errs(zerolog.ErrorFieldName, j.Unwrap())
+		return
+	}
+	e.Err(err)
+}
+
+// V returns a new logr.InfoLogger with the given verbosity. The verbosity is
+// emitted unchanged as an int unless it exceeds Options.MaxVerbosity, negative
+// values are below the debug threshold and values beyond the trace threshold
+// are logged at zerolog.TraceLevel.
 func (l logger) V(verbosity int) logr.InfoLogger {
 	new := l.clone()
-	new.verbosity = verbosity
+	new.verbosity = l.opts.clampVerbosity(verbosity)
+	if l.opts.SyncZerologLevel {
+		// never lower the level of the zerolog logger, only filter stricter
+		if lvl := new.level(); lvl > l.l.GetLevel() {
+			zl := l.l.Level(lvl)
+			new.l = &zl
+		}
+	}
 	return new
 }
 
 // WithName returns a new logr.Logger with the specified name appended. zerologr
 // uses '/' characters to separate name elements.  Callers should not pass '/'
-// in the provided name string, but this library does not actually enforce that.
+// in the provided name string, but this library does not actually enforce that
+// unless Options.SanitizeName is set.
 func (l logger) WithName(name string) logr.Logger {
+	if l.opts.SanitizeName {
+		name = strings.Replace(name, "/", "_", -1)
+	}
 	new := l.clone()
 	if len(l.prefix) > 0 {
 		new.prefix = l.prefix + "/"
@@ -167,6 +1319,16 @@ func (l logger) WithName(name string) logr.Logger {
 	return new
 }
 func (l logger) WithValues(kvList ...interface{}) logr.Logger {
+	if l.opts.ValidateWithValues {
+		if err := validate(l.expandAttrs(kvList)); err != nil {
+			if l.opts.PanicOnInvalidValues {
+				panic(err)
+			}
+			if l.opts.OnInternalError != nil {
+				l.opts.OnInternalError(err)
+			}
+		}
+	}
 	new := l.clone()
 	new.values = append(new.values, kvList...)
 	return new